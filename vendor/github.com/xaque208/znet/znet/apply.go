@@ -0,0 +1,162 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultApplyConcurrency is used when ApplyOptions.Concurrency is zero.
+const DefaultApplyConcurrency = 8
+
+// ErrSkippedStopOnError is the HostResult.Err for a host that was never
+// attempted because an earlier host failed and ApplyOptions.StopOnError
+// is set. ctx is not cancelled in this case, so this is distinct from
+// ctx.Err(), and lets callers tell a deliberately skipped host apart from
+// one that actually ran and succeeded.
+var ErrSkippedStopOnError = errors.New("skipped: a previous host failed and StopOnError is set")
+
+// ApplyOptions configures a ConfigureNetworkHosts run.
+type ApplyOptions struct {
+	// Commit commits each host's candidate configuration when its diff
+	// contains changes; otherwise the candidate is rolled back.
+	Commit bool
+
+	// Concurrency bounds how many hosts are configured at once. Zero
+	// means DefaultApplyConcurrency.
+	Concurrency int
+
+	// PerDriverConcurrency further bounds concurrency for a given
+	// driver name (e.g. "junos"), on top of Concurrency, so a TACACS
+	// server shared by many hosts of one vendor isn't hit by every
+	// worker at once.
+	PerDriverConcurrency map[string]int
+
+	// ConnectJitter, when set, inserts a random delay up to this
+	// duration before each host's connect, to spread out auth load
+	// across a fleet instead of bursting it all at once.
+	ConnectJitter time.Duration
+
+	// StopOnError stops launching new hosts as soon as one fails. Hosts
+	// already in flight are allowed to finish.
+	StopOnError bool
+
+	// OnHostDone, if set, is called as each host finishes, in addition
+	// to that host's HostResult being included in the returned slice.
+	OnHostDone func(HostResult)
+}
+
+// HostResult is the outcome of configuring a single host via
+// ConfigureNetworkHosts.
+type HostResult struct {
+	Host *NetworkHost
+	Plan *ChangePlan
+	Err  error
+}
+
+// ConfigureNetworkHosts fans ConfigureNetworkHost out over hosts using a
+// bounded worker pool, returning one HostResult per host in the same
+// order as hosts. Once ctx is cancelled, hosts not yet started get
+// ctx.Err() as their HostResult.Err, and hosts already in flight see the
+// cancelled ctx in their own rendering and driver calls.
+func (z *Znet) ConfigureNetworkHosts(ctx context.Context, hosts []*NetworkHost, opts ApplyOptions) []HostResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultApplyConcurrency
+	}
+
+	results := make([]HostResult, len(hosts))
+
+	sem := make(chan struct{}, concurrency)
+	driverSem := map[string]chan struct{}{}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		stopped int32
+	)
+
+	driverLimiter := func(host *NetworkHost) chan struct{} {
+		name := z.driverNameForHost(host)
+
+		limit, ok := opts.PerDriverConcurrency[name]
+		if !ok || limit <= 0 {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		ch, ok := driverSem[name]
+		if !ok {
+			ch = make(chan struct{}, limit)
+			driverSem[name] = ch
+		}
+
+		return ch
+	}
+
+	for i, host := range hosts {
+		if opts.StopOnError && atomic.LoadInt32(&stopped) != 0 {
+			results[i] = HostResult{Host: host, Err: ErrSkippedStopOnError}
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, host *NetworkHost) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if opts.StopOnError && atomic.LoadInt32(&stopped) != 0 {
+				results[i] = HostResult{Host: host, Err: ErrSkippedStopOnError}
+				return
+			}
+
+			if dsem := driverLimiter(host); dsem != nil {
+				dsem <- struct{}{}
+				defer func() { <-dsem }()
+			}
+
+			result := z.configureOneHost(ctx, host, opts)
+			results[i] = result
+
+			if result.Err != nil && opts.StopOnError {
+				atomic.StoreInt32(&stopped, 1)
+			}
+
+			if opts.OnHostDone != nil {
+				opts.OnHostDone(result)
+			}
+		}(i, host)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// configureOneHost applies opts.ConnectJitter and then runs
+// ConfigureNetworkHost for a single host, honoring ctx cancellation
+// before starting work.
+func (z *Znet) configureOneHost(ctx context.Context, host *NetworkHost, opts ApplyOptions) HostResult {
+	if err := ctx.Err(); err != nil {
+		return HostResult{Host: host, Err: err}
+	}
+
+	if opts.ConnectJitter > 0 {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(opts.ConnectJitter)))):
+		case <-ctx.Done():
+			return HostResult{Host: host, Err: ctx.Err()}
+		}
+	}
+
+	plan, err := z.ConfigureNetworkHost(ctx, host, opts.Commit)
+
+	return HostResult{Host: host, Plan: plan, Err: err}
+}
@@ -0,0 +1,180 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// errTestDiff is returned by applyTestDriver.Diff to simulate a host
+// failure in StopOnError tests.
+var errTestDiff = errors.New("diff failed")
+
+// concurrencyTracker records how many driver calls were in flight at once,
+// so a test can assert a cap was actually honored rather than just that
+// the calls eventually completed.
+type concurrencyTracker struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrencyTracker) enter() {
+	c.mu.Lock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+	c.mu.Unlock()
+}
+
+func (c *concurrencyTracker) leave() {
+	c.mu.Lock()
+	c.current--
+	c.mu.Unlock()
+}
+
+func (c *concurrencyTracker) peak() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max
+}
+
+// applyTestDriver is a NetworkDeviceDriver that sleeps for a bit on
+// Connect to simulate a slow device, optionally recording the overlap via
+// a concurrencyTracker, and optionally failing Diff for a chosen host.
+type applyTestDriver struct {
+	tracker *concurrencyTracker
+	sleep   time.Duration
+	failErr error
+}
+
+func (d *applyTestDriver) Connect(ctx context.Context, host *NetworkHost, creds Credentials) error {
+	if d.tracker != nil {
+		d.tracker.enter()
+		defer d.tracker.leave()
+	}
+	if d.sleep > 0 {
+		time.Sleep(d.sleep)
+	}
+	return nil
+}
+
+func (d *applyTestDriver) Lock(ctx context.Context) error {
+	return nil
+}
+
+func (d *applyTestDriver) LoadCandidate(ctx context.Context, rendered []string) error {
+	return nil
+}
+
+func (d *applyTestDriver) Diff(ctx context.Context) (string, error) {
+	return "", d.failErr
+}
+
+func (d *applyTestDriver) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (d *applyTestDriver) Rollback(ctx context.Context) error {
+	return nil
+}
+
+func (d *applyTestDriver) Unlock(ctx context.Context) error {
+	return nil
+}
+
+func (d *applyTestDriver) Close() error {
+	return nil
+}
+
+func applyTestHosts(n int, driverName string) []*NetworkHost {
+	hosts := make([]*NetworkHost, n)
+	for i := range hosts {
+		hosts[i] = &NetworkHost{
+			HostName: driverName + "-host",
+			Name:     driverName + "-host",
+			Driver:   driverName,
+		}
+	}
+	return hosts
+}
+
+func TestConfigureNetworkHostsStopOnErrorSkipsRemainingHosts(t *testing.T) {
+	const driverName = "apply-test-stop-on-error"
+	hosts := applyTestHosts(4, driverName)
+
+	var dispatched int32
+	RegisterDriver(driverName, func() NetworkDeviceDriver {
+		n := atomic.AddInt32(&dispatched, 1)
+		if n == 1 {
+			return &applyTestDriver{failErr: errTestDiff}
+		}
+		return &applyTestDriver{}
+	})
+
+	z := &Znet{Credentials: stubCredentialProvider{}}
+	results := z.ConfigureNetworkHosts(context.Background(), hosts, ApplyOptions{
+		Concurrency: 1,
+		StopOnError: true,
+	})
+
+	if results[0].Err == nil {
+		t.Fatal("expected the first host to fail")
+	}
+
+	for i := 1; i < len(results); i++ {
+		if results[i].Err != ErrSkippedStopOnError {
+			t.Fatalf("host %d: expected ErrSkippedStopOnError, got %v", i, results[i].Err)
+		}
+	}
+}
+
+func TestConfigureNetworkHostsPerDriverConcurrencyCapsOverlap(t *testing.T) {
+	const driverName = "apply-test-per-driver-cap"
+	hosts := applyTestHosts(6, driverName)
+
+	tracker := &concurrencyTracker{}
+	RegisterDriver(driverName, func() NetworkDeviceDriver {
+		return &applyTestDriver{tracker: tracker, sleep: 20 * time.Millisecond}
+	})
+
+	z := &Znet{Credentials: stubCredentialProvider{}}
+	z.ConfigureNetworkHosts(context.Background(), hosts, ApplyOptions{
+		Concurrency:          6,
+		PerDriverConcurrency: map[string]int{driverName: 2},
+	})
+
+	if peak := tracker.peak(); peak > 2 {
+		t.Fatalf("expected at most 2 concurrent %s drivers, saw %d", driverName, peak)
+	}
+}
+
+func TestConfigureNetworkHostsReturnsResultsInInputOrder(t *testing.T) {
+	const driverName = "apply-test-order"
+	hosts := applyTestHosts(5, driverName)
+	for i, h := range hosts {
+		h.HostName = driverName + "-" + string(rune('a'+i))
+		h.Name = h.HostName
+	}
+
+	RegisterDriver(driverName, func() NetworkDeviceDriver {
+		// All hosts run concurrently and may finish in any order; only
+		// ConfigureNetworkHosts writing to results[i] by index keeps the
+		// returned slice in input order regardless.
+		return &applyTestDriver{sleep: 5 * time.Millisecond}
+	})
+
+	z := &Znet{Credentials: stubCredentialProvider{}}
+	results := z.ConfigureNetworkHosts(context.Background(), hosts, ApplyOptions{Concurrency: 5})
+
+	for i, r := range results {
+		if r.Host != hosts[i] {
+			t.Fatalf("result %d: expected host %s, got %v", i, hosts[i].HostName, r.Host)
+		}
+	}
+}
+
@@ -0,0 +1,80 @@
+package znet
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// CredentialProvider resolves the authentication material to use when
+// connecting to a given host. Implementations beyond the viper-backed
+// default live in the credentials subpackage: environment variables,
+// HashiCorp Vault, and an exec-based helper modeled on git's credential
+// helpers.
+type CredentialProvider interface {
+	// CredentialsFor returns the Credentials to use for host.
+	CredentialsFor(ctx context.Context, host *NetworkHost) (Credentials, error)
+}
+
+// credentialProvider returns z.Credentials, defaulting to a provider that
+// reproduces the historical behavior of reading junos.username and
+// junos.keyfile from viper for every host. Safe to call concurrently, as
+// ConfigureNetworkHosts does across its worker pool.
+func (z *Znet) credentialProvider() CredentialProvider {
+	z.credentialsOnce.Do(func() {
+		if z.Credentials == nil {
+			z.Credentials = viperCredentialProvider{}
+		}
+	})
+
+	return z.Credentials
+}
+
+// viperCredentialProvider reproduces the original behavior of reading
+// junos.username and junos.keyfile from viper for every host.
+type viperCredentialProvider struct{}
+
+func (viperCredentialProvider) CredentialsFor(ctx context.Context, host *NetworkHost) (Credentials, error) {
+	return Credentials{
+		Username:   viper.GetString("junos.username"),
+		PrivateKey: viper.GetString("junos.keyfile"),
+	}, nil
+}
+
+// CachingCredentialProvider wraps another CredentialProvider and caches
+// its result per host until the Credentials' ExpiresAt, so short-lived
+// leases (e.g. issued by Vault) are renewed automatically while
+// longer-lived credentials aren't re-fetched for every host.
+type CachingCredentialProvider struct {
+	Provider CredentialProvider
+
+	mu    sync.Mutex
+	cache map[string]Credentials
+}
+
+// CredentialsFor returns the cached Credentials for host if present and
+// unexpired, otherwise it delegates to the wrapped Provider and caches
+// the result.
+func (c *CachingCredentialProvider) CredentialsFor(ctx context.Context, host *NetworkHost) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache == nil {
+		c.cache = map[string]Credentials{}
+	}
+
+	if creds, ok := c.cache[host.Name]; ok && (creds.ExpiresAt.IsZero() || creds.ExpiresAt.After(time.Now())) {
+		return creds, nil
+	}
+
+	creds, err := c.Provider.CredentialsFor(ctx, host)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	c.cache[host.Name] = creds
+
+	return creds, nil
+}
@@ -0,0 +1,41 @@
+// Package credentials provides znet.CredentialProvider implementations
+// beyond znet's viper-backed default: environment variables, HashiCorp
+// Vault, and an exec-based helper modeled on git's credential helpers.
+package credentials
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/xaque208/znet/znet"
+)
+
+// EnvProvider resolves credentials from environment variables named
+// ZNET_<HOST>_USERNAME / _PASSWORD / _PRIVATE_KEY, falling back to the
+// unprefixed ZNET_USERNAME / _PASSWORD / _PRIVATE_KEY when no
+// host-specific variable is set.
+type EnvProvider struct{}
+
+// CredentialsFor implements znet.CredentialProvider.
+func (EnvProvider) CredentialsFor(ctx context.Context, host *znet.NetworkHost) (znet.Credentials, error) {
+	prefix := "ZNET_" + strings.ToUpper(strings.ReplaceAll(host.Name, "-", "_")) + "_"
+
+	return znet.Credentials{
+		Username:   firstEnv(prefix+"USERNAME", "ZNET_USERNAME"),
+		Password:   firstEnv(prefix+"PASSWORD", "ZNET_PASSWORD"),
+		PrivateKey: firstEnv(prefix+"PRIVATE_KEY", "ZNET_PRIVATE_KEY"),
+	}, nil
+}
+
+// firstEnv returns the value of the first name that is set in the
+// environment, or the empty string if none are.
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
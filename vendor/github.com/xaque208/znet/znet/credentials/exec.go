@@ -0,0 +1,61 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/xaque208/znet/znet"
+)
+
+// ExecProvider resolves credentials by running an external script, in
+// the spirit of git's credential helpers. The script is invoked as
+// `<Command> <Args...> get <host.Name>` and must print a JSON object
+// with username, password, private_key and optional
+// expires_in_seconds fields on stdout.
+type ExecProvider struct {
+	Command string
+	Args    []string
+}
+
+// execResponse is the JSON shape an ExecProvider script must print.
+type execResponse struct {
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	PrivateKey       string `json:"private_key"`
+	ExpiresInSeconds int    `json:"expires_in_seconds"`
+}
+
+// CredentialsFor implements znet.CredentialProvider.
+func (p ExecProvider) CredentialsFor(ctx context.Context, host *znet.NetworkHost) (znet.Credentials, error) {
+	args := append(append([]string{}, p.Args...), "get", host.Name)
+
+	cmd := exec.CommandContext(ctx, p.Command, args...)
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		return znet.Credentials{}, fmt.Errorf("exec credential helper %s: %w", p.Command, err)
+	}
+
+	var resp execResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return znet.Credentials{}, fmt.Errorf("parse credential helper output: %w", err)
+	}
+
+	creds := znet.Credentials{
+		Username:   resp.Username,
+		Password:   resp.Password,
+		PrivateKey: resp.PrivateKey,
+	}
+
+	if resp.ExpiresInSeconds > 0 {
+		creds.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresInSeconds) * time.Second)
+	}
+
+	return creds, nil
+}
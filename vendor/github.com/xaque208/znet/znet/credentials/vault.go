@@ -0,0 +1,100 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+
+	"github.com/xaque208/znet/znet"
+)
+
+// VaultProvider resolves credentials from HashiCorp Vault. When SSHRole
+// is set it signs PublicKey through an ssh secrets engine role into a
+// short-lived certificate; otherwise it reads a KV v2 secret at
+// KVMount/data/KVPath/<host.Name> with "username" and "password" fields.
+type VaultProvider struct {
+	Client *vaultapi.Client
+
+	KVMount string
+	KVPath  string
+
+	SSHMount  string
+	SSHRole   string
+	PublicKey string
+}
+
+// CredentialsFor implements znet.CredentialProvider.
+func (p VaultProvider) CredentialsFor(ctx context.Context, host *znet.NetworkHost) (znet.Credentials, error) {
+	if p.SSHRole != "" {
+		return p.signSSHCert(ctx, host)
+	}
+
+	return p.readKV(ctx, host)
+}
+
+// readKV reads the KV v2 secret for host and returns it as Credentials,
+// honoring the lease's TTL.
+func (p VaultProvider) readKV(ctx context.Context, host *znet.NetworkHost) (znet.Credentials, error) {
+	path := fmt.Sprintf("%s/data/%s/%s", p.KVMount, p.KVPath, host.Name)
+
+	secret, err := p.Client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return znet.Credentials{}, fmt.Errorf("vault kv read %s: %w", path, err)
+	}
+	if secret == nil {
+		return znet.Credentials{}, fmt.Errorf("vault kv read %s: no secret", path)
+	}
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	if !ok {
+		return znet.Credentials{}, fmt.Errorf("vault kv read %s: malformed secret, expected a KV v2 \"data\" field", path)
+	}
+
+	username, _ := data["username"].(string)
+	password, _ := data["password"].(string)
+
+	return znet.Credentials{
+		Username:  username,
+		Password:  password,
+		ExpiresAt: leaseExpiry(secret.LeaseDuration),
+	}, nil
+}
+
+// signSSHCert signs p.PublicKey through the ssh secrets engine for host
+// and returns the signed certificate as Credentials.PrivateKey.
+func (p VaultProvider) signSSHCert(ctx context.Context, host *znet.NetworkHost) (znet.Credentials, error) {
+	path := fmt.Sprintf("%s/sign/%s", p.SSHMount, p.SSHRole)
+
+	secret, err := p.Client.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"public_key":       p.PublicKey,
+		"valid_principals": host.Name,
+	})
+	if err != nil {
+		return znet.Credentials{}, fmt.Errorf("vault ssh sign %s: %w", path, err)
+	}
+	if secret == nil {
+		return znet.Credentials{}, fmt.Errorf("vault ssh sign %s: no secret", path)
+	}
+
+	cert, ok := secret.Data["signed_key"].(string)
+	if !ok {
+		return znet.Credentials{}, fmt.Errorf("vault ssh sign %s: malformed secret, expected a \"signed_key\" field", path)
+	}
+
+	return znet.Credentials{
+		PrivateKey: cert,
+		ExpiresAt:  leaseExpiry(secret.LeaseDuration),
+	}, nil
+}
+
+// leaseExpiry converts a Vault lease duration in seconds into an
+// absolute expiry, returning the zero time for a non-expiring lease.
+func leaseExpiry(leaseSeconds int) time.Time {
+	if leaseSeconds <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(leaseSeconds) * time.Second)
+}
@@ -0,0 +1,45 @@
+package znet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// fakeCredentialProvider records the host it was asked about and returns a
+// fixed set of Credentials, so tests can tell whether a caller actually
+// consulted it rather than falling back to viper.
+type fakeCredentialProvider struct {
+	calledFor string
+	creds     Credentials
+}
+
+func (p *fakeCredentialProvider) CredentialsFor(ctx context.Context, host *NetworkHost) (Credentials, error) {
+	p.calledFor = host.HostName
+	return p.creds, nil
+}
+
+func TestConnectHostUsesConfiguredProviderNotViper(t *testing.T) {
+	viper.Set("junos.username", "viper-user")
+	viper.Set("junos.keyfile", "/viper/keyfile")
+	defer viper.Set("junos.username", nil)
+	defer viper.Set("junos.keyfile", nil)
+
+	provider := &fakeCredentialProvider{creds: Credentials{Username: "fake-user", PrivateKey: "/fake/keyfile"}}
+	driver := &fakeDriver{}
+	RegisterDriver("credentials-test-driver", func() NetworkDeviceDriver { return driver })
+
+	z := &Znet{Credentials: provider}
+	host := &NetworkHost{HostName: "switch1.example.com", Name: "switch1", Driver: "credentials-test-driver"}
+
+	got, err := z.connectHost(context.Background(), host)
+	if err != nil {
+		t.Fatalf("connectHost: %v", err)
+	}
+	defer got.Close()
+
+	if provider.calledFor != host.HostName {
+		t.Fatalf("expected the configured provider to be consulted for %s, got %q", host.HostName, provider.calledFor)
+	}
+}
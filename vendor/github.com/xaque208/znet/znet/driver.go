@@ -0,0 +1,103 @@
+package znet
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// NetworkDeviceDriver abstracts the vendor-specific mechanics of
+// connecting to, loading, diffing and committing a candidate
+// configuration onto a network device, so that ConfigureNetworkHost and
+// PlanNetworkHost are not hard-coded to JunOS. Implementations live in
+// subpackages such as drivers/junos and drivers/eapi, and register
+// themselves with RegisterDriver from an init function.
+type NetworkDeviceDriver interface {
+	// Connect dials the device identified by host and authenticates
+	// using creds.
+	Connect(ctx context.Context, host *NetworkHost, creds Credentials) error
+
+	// Lock acquires an exclusive configuration session on the device.
+	Lock(ctx context.Context) error
+
+	// LoadCandidate loads rendered as the candidate configuration.
+	LoadCandidate(ctx context.Context, rendered []string) error
+
+	// Diff returns the vendor-computed diff between the candidate and
+	// running configuration.
+	Diff(ctx context.Context) (string, error)
+
+	// Commit commits the loaded candidate configuration.
+	Commit(ctx context.Context) error
+
+	// Rollback discards the loaded candidate configuration.
+	Rollback(ctx context.Context) error
+
+	// Unlock releases the configuration session acquired by Lock.
+	Unlock(ctx context.Context) error
+
+	// Close tears down the connection to the device.
+	Close() error
+}
+
+// Credentials carries the authentication material used to connect to a
+// network device.
+type Credentials struct {
+	Username   string
+	Password   string
+	PrivateKey string
+
+	// ExpiresAt is when these Credentials stop being valid, for
+	// short-lived material such as a Vault lease. The zero value means
+	// the Credentials do not expire.
+	ExpiresAt time.Time
+}
+
+// DriverFactory constructs a new, unconnected NetworkDeviceDriver.
+type DriverFactory func() NetworkDeviceDriver
+
+// DefaultDriver is the driver name used for hosts that do not specify one
+// via NetworkHost.Driver or hierarchy data.
+const DefaultDriver = "junos"
+
+// drivers holds the registered DriverFactory for each known driver name.
+var drivers = map[string]DriverFactory{}
+
+// RegisterDriver makes a NetworkDeviceDriver available under name for
+// hosts whose Driver field selects it. Driver packages call this from an
+// init function; callers of znet must blank-import the driver packages
+// they intend to use.
+func RegisterDriver(name string, factory DriverFactory) {
+	drivers[name] = factory
+}
+
+// driverNameForHost resolves the driver name to use for host: host.Driver
+// if set, otherwise the "driver" key from host's hierarchy data, otherwise
+// DefaultDriver. ConfigureNetworkHosts uses this too, so a host's
+// per-driver concurrency limit is keyed by the same name its driver is
+// actually selected by.
+func (z *Znet) driverNameForHost(host *NetworkHost) string {
+	if host.Driver != "" {
+		return host.Driver
+	}
+
+	if v, ok := lookup(z.loadHierarchyLayers(*host), "driver").(string); ok && v != "" {
+		return v
+	}
+
+	return DefaultDriver
+}
+
+// driverForHost returns a new, unconnected driver instance for host,
+// selecting by host.Driver, falling back to a "driver" key in host's
+// hierarchy data, and finally to DefaultDriver.
+func (z *Znet) driverForHost(host *NetworkHost) (NetworkDeviceDriver, error) {
+	name := z.driverNameForHost(host)
+
+	factory, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("no driver registered for %q", name)
+	}
+
+	return factory(), nil
+}
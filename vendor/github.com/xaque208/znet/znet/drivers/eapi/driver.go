@@ -0,0 +1,202 @@
+// Package eapi implements znet.NetworkDeviceDriver against Arista's eAPI,
+// a JSON-RPC interface exposed by EOS over HTTPS. Callers that want it
+// available must blank-import this package so its init function can
+// register it.
+package eapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xaque208/znet/znet"
+)
+
+func init() {
+	znet.RegisterDriver("eapi", func() znet.NetworkDeviceDriver {
+		return &Driver{client: http.DefaultClient}
+	})
+}
+
+// Driver implements znet.NetworkDeviceDriver against an Arista EOS device
+// using eAPI. EOS has no candidate/commit model of its own, so Lock
+// starts a configuration session and Commit/Rollback complete or abandon
+// that session.
+type Driver struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+	session  string
+	staged   []string
+
+	// sessionOpen is true from a successful Lock until Commit or
+	// Rollback completes, so Unlock knows whether it still needs to
+	// abort an abandoned session.
+	sessionOpen bool
+}
+
+// Connect records the connection details for host; eAPI calls
+// authenticate per-request, so no session is opened here.
+func (d *Driver) Connect(ctx context.Context, host *znet.NetworkHost, creds znet.Credentials) error {
+	d.url = fmt.Sprintf("https://%s/command-api", host.HostName)
+	d.username = creds.Username
+	d.password = creds.Password
+	d.session = fmt.Sprintf("znet-%s", host.Name)
+
+	return nil
+}
+
+// Lock opens a named configuration session on the device.
+func (d *Driver) Lock(ctx context.Context) error {
+	_, err := d.run(ctx, []string{
+		"enable",
+		fmt.Sprintf("configure session %s", d.session),
+	})
+	if err != nil {
+		return err
+	}
+
+	d.sessionOpen = true
+
+	return nil
+}
+
+// LoadCandidate stages rendered as pending commands within the
+// configuration session.
+func (d *Driver) LoadCandidate(ctx context.Context, rendered []string) error {
+	var commands []string
+	for _, r := range rendered {
+		commands = append(commands, strings.Split(strings.TrimSpace(r), "\n")...)
+	}
+
+	d.staged = commands
+
+	cmds := append([]string{
+		"enable",
+		fmt.Sprintf("configure session %s", d.session),
+	}, commands...)
+
+	_, err := d.run(ctx, cmds)
+
+	return err
+}
+
+// Diff returns the pending configuration session's diff against the
+// running configuration.
+func (d *Driver) Diff(ctx context.Context) (string, error) {
+	result, err := d.run(ctx, []string{
+		"enable",
+		fmt.Sprintf("show session-config named %s diffs", d.session),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// Commit replaces the running configuration with the staged session.
+func (d *Driver) Commit(ctx context.Context) error {
+	_, err := d.run(ctx, []string{
+		"enable",
+		fmt.Sprintf("configure session %s", d.session),
+		"commit",
+	})
+	if err != nil {
+		return err
+	}
+
+	d.sessionOpen = false
+
+	return nil
+}
+
+// Rollback abandons the staged configuration session.
+func (d *Driver) Rollback(ctx context.Context) error {
+	_, err := d.run(ctx, []string{
+		"enable",
+		fmt.Sprintf("configure session %s", d.session),
+		"abort",
+	})
+	if err != nil {
+		return err
+	}
+
+	d.sessionOpen = false
+
+	return nil
+}
+
+// Unlock aborts the configuration session if Commit or Rollback hasn't
+// already closed it. This is what makes it safe for callers to defer
+// Unlock unconditionally after a successful Lock: a caller that already
+// committed or rolled back finds sessionOpen false and does nothing.
+func (d *Driver) Unlock(ctx context.Context) error {
+	if !d.sessionOpen {
+		return nil
+	}
+
+	return d.Rollback(ctx)
+}
+
+// Close is a no-op; eAPI is stateless over HTTPS.
+func (d *Driver) Close() error {
+	return nil
+}
+
+// run issues commands to the device's JSON-RPC endpoint and returns the
+// concatenated text output.
+func (d *Driver) run(ctx context.Context, commands []string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "runCmds",
+		"params": map[string]interface{}{
+			"version": 1,
+			"cmds":    commands,
+			"format":  "text",
+		},
+		"id": d.session,
+	})
+	if err != nil {
+		return "", fmt.Errorf("encode eapi request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("build eapi request: %w", err)
+	}
+	req.SetBasicAuth(d.username, d.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("eapi request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Result []struct {
+			Output string `json:"output"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", fmt.Errorf("decode eapi response: %w", err)
+	}
+	if decoded.Error != nil {
+		return "", fmt.Errorf("eapi: %s", decoded.Error.Message)
+	}
+
+	var out []string
+	for _, r := range decoded.Result {
+		out = append(out, r.Output)
+	}
+
+	return strings.Join(out, "\n"), nil
+}
@@ -0,0 +1,80 @@
+// Package junos implements znet.NetworkDeviceDriver on top of the
+// go-junos NETCONF-over-SSH client. It is the default driver used by
+// Znet, and callers that want it available must blank-import this
+// package so its init function can register it.
+package junos
+
+import (
+	"context"
+	"fmt"
+
+	junos "github.com/scottdware/go-junos"
+
+	"github.com/xaque208/znet/znet"
+)
+
+func init() {
+	znet.RegisterDriver("junos", func() znet.NetworkDeviceDriver {
+		return &Driver{}
+	})
+}
+
+// Driver implements znet.NetworkDeviceDriver against a JunOS device using
+// go-junos.
+type Driver struct {
+	session *junos.Junos
+}
+
+// Connect dials host and authenticates using creds.
+func (d *Driver) Connect(ctx context.Context, host *znet.NetworkHost, creds znet.Credentials) error {
+	auth := &junos.AuthMethod{
+		Username:   creds.Username,
+		PrivateKey: creds.PrivateKey,
+	}
+
+	session, err := junos.NewSession(host.HostName, auth)
+	if err != nil {
+		return fmt.Errorf("connect %s: %w", host.HostName, err)
+	}
+
+	d.session = session
+
+	return nil
+}
+
+// Lock acquires an exclusive configuration session on the device.
+func (d *Driver) Lock(ctx context.Context) error {
+	return d.session.Lock()
+}
+
+// LoadCandidate loads rendered as the candidate configuration.
+func (d *Driver) LoadCandidate(ctx context.Context, rendered []string) error {
+	return d.session.Config(rendered, "text", false)
+}
+
+// Diff returns the vendor-computed diff between the candidate and
+// running configuration.
+func (d *Driver) Diff(ctx context.Context) (string, error) {
+	return d.session.Diff(0)
+}
+
+// Commit commits the loaded candidate configuration.
+func (d *Driver) Commit(ctx context.Context) error {
+	return d.session.Commit()
+}
+
+// Rollback discards the loaded candidate configuration.
+func (d *Driver) Rollback(ctx context.Context) error {
+	return d.session.Config("rollback", "text", false)
+}
+
+// Unlock releases the configuration session acquired by Lock.
+func (d *Driver) Unlock(ctx context.Context) error {
+	return d.session.Unlock()
+}
+
+// Close tears down the connection to the device.
+func (d *Driver) Close() error {
+	d.session.Close()
+	return nil
+}
@@ -0,0 +1,158 @@
+package znet
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/template"
+)
+
+// includePattern extracts the partial name from a {{ include "name" . }}
+// action, used for static cycle detection before any partial is parsed.
+var includePattern = regexp.MustCompile(`{{\s*include\s+"([^"]+)"`)
+
+// loadPartials parses every *.tmpl file in dir/_partials into a single
+// *template.Template set, named by file basename, and wires an "include"
+// function into that set so any template built from it can reference
+// another by name. It is an error for the partials to include one
+// another in a cycle.
+//
+// It also registers stub lookup/lookupArray/lookupHash funcs so partials
+// using them parse successfully even though this set has no host to
+// resolve them against yet; RenderHostTemplateFile overrides these with
+// the real, per-host closures on its own clone of the cache entry before
+// executing it, and since Funcs operates on the shared func map of the
+// whole associated-template set, that override reaches any partial the
+// device template includes too.
+func loadPartials(dir string) (*template.Template, error) {
+	sources, err := readPartialSources(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := detectIncludeCycle(sources); err != nil {
+		return nil, err
+	}
+
+	set := template.New("partials")
+	set = set.Funcs(template.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			partial := set.Lookup(name)
+			if partial == nil {
+				return "", fmt.Errorf("include: partial %q not found", name)
+			}
+
+			var buf bytes.Buffer
+			if err := partial.Execute(&buf, data); err != nil {
+				return "", fmt.Errorf("include %q: %w", name, err)
+			}
+
+			return buf.String(), nil
+		},
+	})
+	set = set.Funcs(lookupFuncStubs())
+
+	for name, src := range sources {
+		if _, err := set.New(name).Parse(src); err != nil {
+			return nil, fmt.Errorf("parse partial %s: %w", name, err)
+		}
+	}
+
+	return set, nil
+}
+
+// lookupFuncStubs returns placeholder lookup/lookupArray/lookupHash funcs
+// with the same signatures RenderHostTemplateFile later installs, purely
+// so the partials set parses: without a name registered here at parse
+// time, any partial calling one of these funcs fails with "function not
+// defined", and since loadPartials only runs once, that failure would be
+// cached forever by TemplateCache.partials and break every template, not
+// just the offending partial.
+func lookupFuncStubs() template.FuncMap {
+	return template.FuncMap{
+		"lookup": func(key string) interface{} {
+			return nil
+		},
+		"lookupArray": func(key string) []interface{} {
+			return nil
+		},
+		"lookupHash": func(key string) (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		},
+	}
+}
+
+// readPartialSources reads every *.tmpl file directly under
+// dir/_partials, keyed by basename.
+func readPartialSources(dir string) (map[string]string, error) {
+	partialDir := filepath.Join(dir, "_partials")
+
+	files, err := filepath.Glob(filepath.Join(partialDir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("glob partials: %w", err)
+	}
+
+	sources := make(map[string]string, len(files))
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read partial %s: %w", f, err)
+		}
+
+		sources[filepath.Base(f)] = string(b)
+	}
+
+	return sources, nil
+}
+
+// detectIncludeCycle walks the static include graph between sources and
+// returns an error describing the cycle if one exists. Diamond includes,
+// where two partials both include a third, are not cycles.
+func detectIncludeCycle(sources map[string]string) error {
+	graph := make(map[string][]string, len(sources))
+	for name, src := range sources {
+		for _, m := range includePattern.FindAllStringSubmatch(src, -1) {
+			graph[name] = append(graph[name], m[1])
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	state := make(map[string]int, len(sources))
+
+	var visit func(node string, path []string) error
+	visit = func(node string, path []string) error {
+		switch state[node] {
+		case visiting:
+			return fmt.Errorf("include cycle detected: %s -> %s", strings.Join(path, " -> "), node)
+		case done:
+			return nil
+		}
+
+		state[node] = visiting
+		for _, dep := range graph[node] {
+			if err := visit(dep, append(path, node)); err != nil {
+				return err
+			}
+		}
+		state[node] = done
+
+		return nil
+	}
+
+	for name := range sources {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
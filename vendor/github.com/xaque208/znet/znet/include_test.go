@@ -0,0 +1,117 @@
+package znet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePartial writes a partial template file under dir/templateDir/_partials.
+func writePartial(t *testing.T, root, templateDir, name, src string) {
+	t.Helper()
+
+	dir := filepath.Join(root, templateDir, "_partials")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateCacheDiamondIncludeParsedOnce(t *testing.T) {
+	root := t.TempDir()
+	const templateDir = "templates"
+
+	writePartial(t, root, templateDir, "left.tmpl", `left: {{ include "shared.tmpl" . }}`)
+	writePartial(t, root, templateDir, "right.tmpl", `right: {{ include "shared.tmpl" . }}`)
+	writePartial(t, root, templateDir, "shared.tmpl", `shared`)
+
+	c, err := NewTemplateCache(root, templateDir, TemplateCacheProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := c.partials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := c.partials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != second {
+		t.Fatal("expected partials() to return the same set on every call, parsing shared.tmpl only once")
+	}
+}
+
+func TestTemplateCacheGetDoesNotCollideOnSharedBasename(t *testing.T) {
+	root := t.TempDir()
+	const templateDir = "templates"
+
+	hostADir := filepath.Join(root, templateDir, "hostA")
+	hostBDir := filepath.Join(root, templateDir, "hostB")
+	if err := os.MkdirAll(hostADir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(hostBDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(hostADir, "device.tmpl"), []byte("host A"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hostBDir, "device.tmpl"), []byte("host B"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewTemplateCache(root, templateDir, TemplateCacheProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(filepath.Join(hostADir, "device.tmpl")); err != nil {
+		t.Fatalf("Get(hostA/device.tmpl): %v", err)
+	}
+
+	if _, err := c.Get(filepath.Join(hostBDir, "device.tmpl")); err != nil {
+		t.Fatalf("Get(hostB/device.tmpl): %v", err)
+	}
+}
+
+func TestIncludeMissingPartialErrors(t *testing.T) {
+	root := t.TempDir()
+	const templateDir = "templates"
+
+	writePartial(t, root, templateDir, "base.tmpl", `{{ include "missing.tmpl" . }}`)
+
+	deviceDir := filepath.Join(root, templateDir, "hostA")
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(deviceDir, "device.tmpl")
+	if err := os.WriteFile(devicePath, []byte(`{{ include "base.tmpl" . }}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewTemplateCache(root, templateDir, TemplateCacheProduction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := c.Get(devicePath)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, nil)
+	if err == nil {
+		t.Fatal("expected executing a template with a missing partial to error")
+	}
+}
@@ -0,0 +1,99 @@
+package znet
+
+import (
+	"fmt"
+
+	"github.com/imdario/mergo"
+	log "github.com/sirupsen/logrus"
+)
+
+// DataLayer pairs a hierarchy file path with the raw data it contributed.
+// DataForDevice discards this once the layers are merged into a HostData;
+// loadHierarchyLayers keeps it around so the lookup template functions can
+// consult the hierarchy one layer at a time.
+type DataLayer struct {
+	Path string
+	Data map[string]interface{}
+}
+
+// loadHierarchyLayers loads each file in host's data hierarchy as a
+// generic map, in the same order DataForDevice merges them.
+func (z *Znet) loadHierarchyLayers(host NetworkHost) []DataLayer {
+	var layers []DataLayer
+
+	for _, f := range z.HierarchyForDevice(host) {
+		raw := map[string]interface{}{}
+		loadYamlFile(f, &raw)
+
+		layers = append(layers, DataLayer{Path: f, Data: raw})
+	}
+
+	return layers
+}
+
+// lookup returns the value of key from the most specific layer that
+// defines it, matching the last-one-wins semantics DataForDevice uses
+// when it merges the hierarchy with mergo.WithOverride.
+func lookup(layers []DataLayer, key string) interface{} {
+	for i := len(layers) - 1; i >= 0; i-- {
+		if v, ok := layers[i].Data[key]; ok {
+			log.Debugf("lookup %q found in %s", key, layers[i].Path)
+			return v
+		}
+	}
+
+	log.Debugf("lookup %q found nothing in hierarchy", key)
+
+	return nil
+}
+
+// lookupArray concatenates the array value of key across every layer of
+// the hierarchy that defines it, in hierarchy order.
+func lookupArray(layers []DataLayer, key string) []interface{} {
+	var result []interface{}
+
+	for _, layer := range layers {
+		v, ok := layer.Data[key]
+		if !ok {
+			continue
+		}
+
+		arr, ok := v.([]interface{})
+		if !ok {
+			log.Warnf("lookupArray %q in %s is not an array, skipping", key, layer.Path)
+			continue
+		}
+
+		log.Debugf("lookupArray %q contributed by %s", key, layer.Path)
+		result = append(result, arr...)
+	}
+
+	return result
+}
+
+// lookupHash deep-merges the hash value of key across every layer of the
+// hierarchy that defines it, with later layers overriding earlier ones.
+func lookupHash(layers []DataLayer, key string) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+
+	for _, layer := range layers {
+		v, ok := layer.Data[key]
+		if !ok {
+			continue
+		}
+
+		hash, ok := v.(map[string]interface{})
+		if !ok {
+			log.Warnf("lookupHash %q in %s is not a hash, skipping", key, layer.Path)
+			continue
+		}
+
+		if err := mergo.Merge(&result, hash, mergo.WithOverride); err != nil {
+			return nil, fmt.Errorf("lookupHash %q: %w", key, err)
+		}
+
+		log.Debugf("lookupHash %q contributed by %s", key, layer.Path)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package znet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupReturnsMostSpecificLayer(t *testing.T) {
+	layers := []DataLayer{
+		{Path: "common.yaml", Data: map[string]interface{}{"snmp": "community1"}},
+		{Path: "hostA.yaml", Data: map[string]interface{}{"snmp": "community2"}},
+	}
+
+	got := lookup(layers, "snmp")
+	if got != "community2" {
+		t.Fatalf("lookup: expected the last layer defining the key to win, got %v", got)
+	}
+}
+
+func TestLookupReturnsNilWhenKeyIsNowhereInHierarchy(t *testing.T) {
+	layers := []DataLayer{
+		{Path: "common.yaml", Data: map[string]interface{}{"snmp": "community1"}},
+	}
+
+	if got := lookup(layers, "missing"); got != nil {
+		t.Fatalf("lookup: expected nil for an undefined key, got %v", got)
+	}
+}
+
+func TestLookupArrayConcatenatesAcrossLayers(t *testing.T) {
+	layers := []DataLayer{
+		{Path: "common.yaml", Data: map[string]interface{}{"ntp_servers": []interface{}{"ntp1", "ntp2"}}},
+		{Path: "hostA.yaml", Data: map[string]interface{}{"ntp_servers": []interface{}{"ntp3"}}},
+	}
+
+	got := lookupArray(layers, "ntp_servers")
+	want := []interface{}{"ntp1", "ntp2", "ntp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("lookupArray: expected %v, got %v", want, got)
+	}
+}
+
+func TestLookupArraySkipsNonArrayLayers(t *testing.T) {
+	layers := []DataLayer{
+		{Path: "common.yaml", Data: map[string]interface{}{"ntp_servers": "not-an-array"}},
+		{Path: "hostA.yaml", Data: map[string]interface{}{"ntp_servers": []interface{}{"ntp3"}}},
+	}
+
+	got := lookupArray(layers, "ntp_servers")
+	want := []interface{}{"ntp3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("lookupArray: expected the non-array layer to be skipped, got %v", got)
+	}
+}
+
+func TestLookupHashDeepMergesWithLaterLayersOverriding(t *testing.T) {
+	layers := []DataLayer{
+		{Path: "common.yaml", Data: map[string]interface{}{
+			"interfaces": map[string]interface{}{"mtu": float64(1500), "description": "default"},
+		}},
+		{Path: "hostA.yaml", Data: map[string]interface{}{
+			"interfaces": map[string]interface{}{"mtu": float64(9000)},
+		}},
+	}
+
+	got, err := lookupHash(layers, "interfaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"mtu": float64(9000), "description": "default"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("lookupHash: expected %v, got %v", want, got)
+	}
+}
+
+func TestLookupHashSkipsNonHashLayers(t *testing.T) {
+	layers := []DataLayer{
+		{Path: "common.yaml", Data: map[string]interface{}{"interfaces": "not-a-hash"}},
+		{Path: "hostA.yaml", Data: map[string]interface{}{
+			"interfaces": map[string]interface{}{"mtu": float64(9000)},
+		}},
+	}
+
+	got, err := lookupHash(layers, "interfaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{"mtu": float64(9000)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("lookupHash: expected the non-hash layer to be skipped, got %v", got)
+	}
+}
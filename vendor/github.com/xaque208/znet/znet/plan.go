@@ -0,0 +1,54 @@
+package znet
+
+import "strings"
+
+// ChangePlan describes the proposed configuration change for a single
+// network host. PlanNetworkHost produces one without ever committing the
+// change to the device; ConfigureNetworkHost returns one whether or not
+// it commits.
+type ChangePlan struct {
+	Host           string
+	RenderedConfig string
+	Diff           string
+	Provenance     []TemplateProvenance
+	Summary        ChangeSummary
+}
+
+// TemplateProvenance records which template file produced a rendered
+// configuration stanza.
+type TemplateProvenance struct {
+	TemplatePath string
+	Rendered     string
+}
+
+// ChangeSummary is a machine-readable summary of a ChangePlan, suitable
+// for CI gating without parsing the raw diff.
+type ChangeSummary struct {
+	Severity   string
+	LineCount  int
+	HasChanges bool
+}
+
+// summarizeDiff derives a ChangeSummary from a raw vendor diff.
+func summarizeDiff(diff string) ChangeSummary {
+	trimmed := strings.TrimSpace(diff)
+	if trimmed == "" {
+		return ChangeSummary{Severity: "none", HasChanges: false}
+	}
+
+	lines := strings.Split(trimmed, "\n")
+
+	severity := "info"
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "-") {
+			severity = "warning"
+			break
+		}
+	}
+
+	return ChangeSummary{
+		Severity:   severity,
+		LineCount:  len(lines),
+		HasChanges: true,
+	}
+}
@@ -0,0 +1,64 @@
+package znet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDataFile writes a hierarchy YAML file under root/dataDir.
+func writeDataFile(t *testing.T, root, dataDir, name, contents string) {
+	t.Helper()
+
+	dir := filepath.Join(root, dataDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenderHostTemplateFileResolvesLookupThroughAPartial renders a device
+// template that includes a partial calling lookup, and checks that the
+// most specific hierarchy layer for the host wins, end to end.
+func TestRenderHostTemplateFileResolvesLookupThroughAPartial(t *testing.T) {
+	root := t.TempDir()
+	const (
+		templateDir = "templates"
+		dataDir     = "data"
+	)
+
+	writeDataFile(t, root, dataDir, "common.yaml", "snmp: community1\n")
+	writeDataFile(t, root, dataDir, "hostA.yaml", "snmp: community2\n")
+
+	writePartial(t, root, templateDir, "snmp.tmpl", `snmp {{ lookup "snmp" }}`)
+
+	deviceDir := filepath.Join(root, templateDir, "switches")
+	if err := os.MkdirAll(deviceDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	devicePath := filepath.Join(deviceDir, "device.tmpl")
+	if err := os.WriteFile(devicePath, []byte(`{{ include "snmp.tmpl" . }}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	z := &Znet{
+		ConfigDir: root,
+		Data: Data{
+			TemplateDir:   templateDir,
+			DataDir:       dataDir,
+			TemplatePaths: []string{"switches"},
+			Hierarchy:     []string{"common.yaml", "{{.Name}}.yaml"},
+		},
+	}
+
+	host := NetworkHost{Name: "hostA", HostName: "hostA.example.com"}
+
+	got := z.RenderHostTemplateFile(host, devicePath)
+	if !strings.Contains(got, "snmp community2") {
+		t.Fatalf("expected rendered output to contain the host-specific snmp community, got %q", got)
+	}
+}
@@ -0,0 +1,235 @@
+package znet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alecthomas/template"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// TemplateCacheMode selects how a TemplateCache keeps its parsed
+// templates fresh.
+type TemplateCacheMode int
+
+const (
+	// TemplateCacheProduction parses each template lazily on first use
+	// and caches it forever.
+	TemplateCacheProduction TemplateCacheMode = iota
+
+	// TemplateCacheDev watches the cache's root directory and every
+	// directory under it with fsnotify and re-parses a template as soon
+	// as its backing file changes, so template authors don't have to
+	// restart the process. Partials under _partials are loaded once and
+	// are not reloaded, and directories created after NewTemplateCache
+	// are not watched.
+	TemplateCacheDev
+)
+
+// TemplateCacheMetrics counts cache activity so operators can tell
+// whether template churn is a hot path.
+type TemplateCacheMetrics struct {
+	Hits        uint64
+	Misses      uint64
+	ParseErrors uint64
+}
+
+// TemplateCache parses .tmpl files once, keyed by absolute path, and
+// reuses the parsed *template.Template across renders. It also caches
+// templates parsed from literal strings, keyed by their source. In
+// TemplateCacheDev mode it watches its root directory tree with fsnotify
+// and invalidates path-based entries as their files are written.
+type TemplateCache struct {
+	mode        TemplateCacheMode
+	root        string
+	templateDir string
+
+	mu         sync.RWMutex
+	entries    map[string]*template.Template
+	strEntries map[string]*template.Template
+
+	hits        uint64
+	misses      uint64
+	parseErrors uint64
+
+	partialsOnce sync.Once
+	partialsSet  *template.Template
+	partialsErr  error
+
+	watcher *fsnotify.Watcher
+}
+
+// NewTemplateCache returns a TemplateCache rooted at root, resolving
+// {{ include }} partials under root/templateDir/_partials, operating in
+// mode. In TemplateCacheDev mode it starts an fsnotify watcher on root
+// and each directory under it; callers should call Close when finished
+// with the cache.
+func NewTemplateCache(root, templateDir string, mode TemplateCacheMode) (*TemplateCache, error) {
+	c := &TemplateCache{
+		mode:        mode,
+		root:        root,
+		templateDir: templateDir,
+		entries:     make(map[string]*template.Template),
+		strEntries:  make(map[string]*template.Template),
+	}
+
+	if mode == TemplateCacheDev {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, fmt.Errorf("start template watcher: %w", err)
+		}
+
+		err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return watcher.Add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("watch %s: %w", root, err)
+		}
+
+		c.watcher = watcher
+		go c.watch()
+	}
+
+	return c, nil
+}
+
+// watch invalidates cache entries as their backing file is written,
+// created or removed.
+func (c *TemplateCache) watch() {
+	for event := range c.watcher.Events {
+		if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove) == 0 {
+			continue
+		}
+
+		abs, err := filepath.Abs(event.Name)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		c.mu.Lock()
+		delete(c.entries, abs)
+		c.mu.Unlock()
+
+		log.Debugf("Invalidated template cache entry for %s", abs)
+	}
+}
+
+// Close stops the dev-mode fsnotify watcher, if any.
+func (c *TemplateCache) Close() error {
+	if c.watcher == nil {
+		return nil
+	}
+
+	return c.watcher.Close()
+}
+
+// partials returns the shared partial template set rooted at
+// root/templateDir/_partials, loading and cycle-checking it on first
+// use. The same set is reused for every Get call, so a partial included
+// by several device templates (a diamond include) is only parsed once.
+func (c *TemplateCache) partials() (*template.Template, error) {
+	c.partialsOnce.Do(func() {
+		c.partialsSet, c.partialsErr = loadPartials(filepath.Join(c.root, c.templateDir))
+	})
+
+	return c.partialsSet, c.partialsErr
+}
+
+// Get returns the parsed template for the file at path, parsing and
+// caching it on first use. The returned template has its own independent
+// namespace — two device templates that happen to share a basename (e.g.
+// each host directory has its own device.tmpl) never collide — but it is
+// cloned from the cache's shared partial set, so it may still call
+// {{ include "partial.tmpl" . }}. The shared set itself is only ever
+// built once, by partials(); cloning it here is read-only and safe to do
+// from many goroutines at once, as ConfigureNetworkHosts does.
+func (c *TemplateCache) Get(path string) (*template.Template, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	tmpl, ok := c.entries[abs]
+	c.mu.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		return tmpl, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	partials, err := c.partials()
+	if err != nil {
+		return nil, fmt.Errorf("load partials: %w", err)
+	}
+
+	b, err := ioutil.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := partials.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("clone partials for %s: %w", abs, err)
+	}
+
+	tmpl, err = set.New(filepath.Base(abs)).Parse(string(b))
+	if err != nil {
+		atomic.AddUint64(&c.parseErrors, 1)
+		return nil, fmt.Errorf("parse %s: %w", abs, err)
+	}
+
+	c.mu.Lock()
+	c.entries[abs] = tmpl
+	c.mu.Unlock()
+
+	return tmpl, nil
+}
+
+// GetString returns the parsed template for the literal template source
+// src, parsing and caching it the first time that exact string is seen.
+func (c *TemplateCache) GetString(src string) (*template.Template, error) {
+	c.mu.RLock()
+	tmpl, ok := c.strEntries[src]
+	c.mu.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		return tmpl, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	tmpl, err := template.New("template").Parse(src)
+	if err != nil {
+		atomic.AddUint64(&c.parseErrors, 1)
+		return nil, fmt.Errorf("parse template string: %w", err)
+	}
+
+	c.mu.Lock()
+	c.strEntries[src] = tmpl
+	c.mu.Unlock()
+
+	return tmpl, nil
+}
+
+// Metrics returns a snapshot of the cache's hit/miss/parse-error counts.
+func (c *TemplateCache) Metrics() TemplateCacheMetrics {
+	return TemplateCacheMetrics{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		ParseErrors: atomic.LoadUint64(&c.parseErrors),
+	}
+}
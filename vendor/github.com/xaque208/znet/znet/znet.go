@@ -2,16 +2,16 @@ package znet
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/alecthomas/template"
 	"github.com/imdario/mergo"
-	junos "github.com/scottdware/go-junos"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 // Znet is the core object for this project.  It keeps track of the data, configuration and flow control for starting the server process.
@@ -20,6 +20,36 @@ type Znet struct {
 	Config    Config
 	Data      Data
 	listener  *Listener
+
+	// Templates is the cache used to parse and render .tmpl files. It
+	// defaults to a TemplateCacheProduction cache rooted at ConfigDir on
+	// first use; set it before that to run in TemplateCacheDev mode.
+	Templates     *TemplateCache
+	templatesOnce sync.Once
+
+	// Credentials resolves per-host authentication material. It
+	// defaults to reading junos.username and junos.keyfile from viper
+	// for every host; set it to use environment variables, Vault, or an
+	// exec-based helper instead.
+	Credentials     CredentialProvider
+	credentialsOnce sync.Once
+}
+
+// templateCache returns z.Templates, lazily creating a production-mode
+// cache rooted at ConfigDir if one hasn't been set. Safe to call
+// concurrently, as ConfigureNetworkHosts does across its worker pool.
+func (z *Znet) templateCache() *TemplateCache {
+	z.templatesOnce.Do(func() {
+		if z.Templates == nil {
+			cache, err := NewTemplateCache(z.ConfigDir, z.Data.TemplateDir, TemplateCacheProduction)
+			if err != nil {
+				log.Error(err)
+			}
+			z.Templates = cache
+		}
+	})
+
+	return z.Templates
 }
 
 // NewZnet creates and returns a new Znet object.
@@ -48,87 +78,223 @@ func (z *Znet) LoadData(configDir string) {
 	z.Data = dataConfig
 }
 
-// ConfigureNetworkHost renders the templates using associated data for a network host.  The hosts about which to load the templates, are retrieved from LDAP.
-func (z *Znet) ConfigureNetworkHost(host *NetworkHost, commit bool) {
-	auth := &junos.AuthMethod{
-		Username:   viper.GetString("junos.username"),
-		PrivateKey: viper.GetString("junos.keyfile"),
+// ConfigureNetworkHost renders the templates using associated data for a
+// network host, loads the candidate configuration onto the device, and
+// commits it when commit is true. The hosts about which to load the
+// templates, are retrieved from LDAP. The returned ChangePlan describes
+// what was rendered and diffed, regardless of whether it was committed.
+func (z *Znet) ConfigureNetworkHost(ctx context.Context, host *NetworkHost, commit bool) (*ChangePlan, error) {
+	driver, err := z.connectHost(ctx, host)
+	if err != nil {
+		return nil, err
 	}
+	defer driver.Close()
 
-	log.Debugf("Connecting to device: %s", host.HostName)
-	session, err := junos.NewSession(host.HostName, auth)
+	plan, locked, err := z.planWithDriver(ctx, driver, host)
+	if locked {
+		defer z.unlock(ctx, driver, host)
+	}
 	if err != nil {
-		log.Error(err)
+		return plan, err
+	}
+
+	if !plan.Summary.HasChanges {
+		return plan, nil
+	}
+
+	log.Infof("Configuration changes for %s: %s", host.HostName, plan.Diff)
+
+	if commit {
+		if err := z.CommitCandidate(ctx, driver); err != nil {
+			return plan, err
+		}
+	} else if err := z.RollbackCandidate(ctx, driver); err != nil {
+		return plan, err
 	}
 
-	defer session.Close()
+	return plan, nil
+}
 
-	// log.Warnf("Auth: %+v", auth)
+// unlock releases a device lock acquired during planWithDriver, logging
+// rather than returning the error: it always runs from a defer, after
+// the caller's own result has already been decided.
+func (z *Znet) unlock(ctx context.Context, driver NetworkDeviceDriver, host *NetworkHost) {
+	if err := driver.Unlock(ctx); err != nil {
+		log.Errorf("unlock %s: %v", host.HostName, err)
+	}
+}
 
-	// log.Warnf("Znet: %+v", z)
-	// log.Warnf("Commit: %t", commit)
-	// log.Warnf("Host: %+v", host)
+// connectHost selects the NetworkDeviceDriver for host and connects it
+// using credentials resolved by z.credentialProvider().
+func (z *Znet) connectHost(ctx context.Context, host *NetworkHost) (NetworkDeviceDriver, error) {
+	driver, err := z.driverForHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := z.credentialProvider().CredentialsFor(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolve credentials for %s: %w", host.HostName, err)
+	}
+
+	log.Debugf("Connecting to device: %s", host.HostName)
+	if err := driver.Connect(ctx, host, creds); err != nil {
+		return nil, err
+	}
+
+	return driver, nil
+}
+
+// RenderCandidateConfig renders every template for host and returns the
+// rendered stanzas along with per-template provenance, without talking to
+// any device.
+func (z *Znet) RenderCandidateConfig(ctx context.Context, host *NetworkHost) ([]string, []TemplateProvenance, error) {
 	templates := z.TemplatesForDevice(*host)
 	log.Debugf("Templates for host %s: %+v", host.Name, templates)
 
 	host.Data = z.DataForDevice(*host)
-	// log.Debugf("Data: %+v", host.Data)
 
-	var renderedTemplates []string
+	var rendered []string
+	var provenance []TemplateProvenance
 	for _, t := range templates {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		default:
+		}
+
 		result := z.RenderHostTemplateFile(*host, t)
-		renderedTemplates = append(renderedTemplates, result)
-		// log.Infof("Result: %+v", result)
+		rendered = append(rendered, result)
+		provenance = append(provenance, TemplateProvenance{
+			TemplatePath: t,
+			Rendered:     result,
+		})
 	}
-	log.Debugf("RenderedTemplates: %+v", renderedTemplates)
+	log.Debugf("RenderedTemplates: %+v", rendered)
 
-	err = session.Lock()
-	if err != nil {
-		log.Error(err)
+	return rendered, provenance, nil
+}
+
+// LockDevice acquires an exclusive configuration session on the device.
+// Once it succeeds, the caller is responsible for eventually calling
+// driver.Unlock, regardless of what happens afterwards.
+func (z *Znet) LockDevice(ctx context.Context, driver NetworkDeviceDriver) error {
+	if err := driver.Lock(ctx); err != nil {
+		return fmt.Errorf("lock: %w", err)
 	}
 
-	err = session.Config(renderedTemplates, "text", false)
+	return nil
+}
+
+// LoadCandidateConfig loads the rendered templates as the candidate
+// configuration. The device must already be locked via LockDevice.
+func (z *Znet) LoadCandidateConfig(ctx context.Context, driver NetworkDeviceDriver, rendered []string) error {
+	if err := driver.LoadCandidate(ctx, rendered); err != nil {
+		return fmt.Errorf("load candidate: %w", err)
+	}
+
+	return nil
+}
+
+// DiffCandidateConfig returns the vendor-computed diff between the loaded
+// candidate configuration and the running configuration.
+func (z *Znet) DiffCandidateConfig(ctx context.Context, driver NetworkDeviceDriver) (string, error) {
+	diff, err := driver.Diff(ctx)
 	if err != nil {
-		log.Error(err)
+		return "", fmt.Errorf("diff: %w", err)
+	}
+
+	return diff, nil
+}
+
+// CommitCandidate commits the previously loaded candidate configuration.
+func (z *Znet) CommitCandidate(ctx context.Context, driver NetworkDeviceDriver) error {
+	if err := driver.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// RollbackCandidate discards the previously loaded candidate configuration.
+func (z *Znet) RollbackCandidate(ctx context.Context, driver NetworkDeviceDriver) error {
+	if err := driver.Rollback(ctx); err != nil {
+		return fmt.Errorf("rollback: %w", err)
 	}
 
-	diff, err := session.Diff(0)
+	return nil
+}
+
+// planWithDriver renders, loads and diffs the candidate configuration for
+// host using an already-connected driver, without committing or rolling
+// back the change. The returned locked flag is true as soon as the
+// device lock is acquired, even if a later step errors, so the caller
+// knows to unlock on every path once it is true.
+func (z *Znet) planWithDriver(ctx context.Context, driver NetworkDeviceDriver, host *NetworkHost) (plan *ChangePlan, locked bool, err error) {
+	rendered, provenance, err := z.RenderCandidateConfig(ctx, host)
 	if err != nil {
-		log.Error(err)
+		return nil, false, err
 	}
 
-	if len(diff) > 1 {
-		log.Infof("Configuration changes for %s: %s", host.HostName, diff)
+	if err := z.LockDevice(ctx, driver); err != nil {
+		return nil, false, err
+	}
 
-		if commit {
-			err = session.Commit()
-			if err != nil {
-				log.Error(err)
-			}
-		} else {
-			err = session.Config("rollback", "text", false)
-			if err != nil {
-				log.Error(err)
-			}
+	if err := z.LoadCandidateConfig(ctx, driver, rendered); err != nil {
+		return nil, true, err
+	}
 
-		}
+	diff, err := z.DiffCandidateConfig(ctx, driver)
+	if err != nil {
+		return nil, true, err
 	}
 
-	err = session.Unlock()
+	return &ChangePlan{
+		Host:           host.HostName,
+		RenderedConfig: strings.Join(rendered, "\n"),
+		Diff:           diff,
+		Provenance:     provenance,
+		Summary:        summarizeDiff(diff),
+	}, true, nil
+}
+
+// PlanNetworkHost renders and loads the candidate configuration for host
+// and returns a ChangePlan describing the proposed changes, rolling back
+// the candidate once it has been diffed; driver.Commit() is never called.
+// If loading or diffing fails, it returns without a rollback.
+// This is safe to run concurrently across many hosts, and the resulting
+// plans are suitable for CI gating.
+func (z *Znet) PlanNetworkHost(ctx context.Context, host *NetworkHost) (*ChangePlan, error) {
+	driver, err := z.connectHost(ctx, host)
 	if err != nil {
-		log.Error(err)
+		return nil, err
+	}
+	defer driver.Close()
+
+	plan, locked, err := z.planWithDriver(ctx, driver, host)
+	if locked {
+		defer z.unlock(ctx, driver, host)
+	}
+	if err != nil {
+		return plan, err
 	}
 
+	if err := z.RollbackCandidate(ctx, driver); err != nil {
+		return plan, err
+	}
+
+	return plan, nil
 }
 
 // TemplateStringsForDevice renders a list of template strings given a host.
 func (z *Znet) TemplateStringsForDevice(host NetworkHost, templates []string) []string {
-	var strings []string
+	var strs []string
 
 	for _, t := range templates {
-		tmpl, err := template.New("template").Parse(t)
+		tmpl, err := z.templateCache().GetString(t)
 		if err != nil {
 			log.Error(err)
+			continue
 		}
 
 		var buf bytes.Buffer
@@ -138,10 +304,10 @@ func (z *Znet) TemplateStringsForDevice(host NetworkHost, templates []string) []
 			log.Error(err)
 		}
 
-		strings = append(strings, buf.String())
+		strs = append(strs, buf.String())
 	}
 
-	return strings
+	return strs
 }
 
 // DataForDevice returns HostData for a given NetworkHost.
@@ -207,21 +373,54 @@ func (z *Znet) TemplatesForDevice(host NetworkHost) []string {
 	return files
 }
 
-// RenderHostTemplateFile renders a template file using a Host object.
+// RenderHostTemplateFile renders a template file using a Host object. The
+// template may call lookup, lookupArray and lookupHash to consult host's
+// data hierarchy one layer at a time, in addition to reading the merged
+// HostData via the usual dot-notation.
 func (z *Znet) RenderHostTemplateFile(host NetworkHost, path string) string {
 	log.Debugf("Rendering host template file %s for host %s", path, host.Name)
 
-	b, err := ioutil.ReadFile(path)
+	cached, err := z.templateCache().Get(path)
 	if err != nil {
 		log.Error(err)
+		return ""
 	}
 
-	str := string(b)
-	tmpl, err := template.New("test").Parse(str)
+	layers := z.loadHierarchyLayers(host)
+
+	tmpl, err := cached.Clone()
 	if err != nil {
 		log.Error(err)
+		return ""
 	}
 
+	// include is rebound to this clone so that included partials run with
+	// the lookup funcs below rather than the stubs of the shared set.
+	tmpl = tmpl.Funcs(template.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			partial := tmpl.Lookup(name)
+			if partial == nil {
+				return "", fmt.Errorf("include: partial %q not found", name)
+			}
+
+			var buf bytes.Buffer
+			if err := partial.Execute(&buf, data); err != nil {
+				return "", fmt.Errorf("include %q: %w", name, err)
+			}
+
+			return buf.String(), nil
+		},
+		"lookup": func(key string) interface{} {
+			return lookup(layers, key)
+		},
+		"lookupArray": func(key string) []interface{} {
+			return lookupArray(layers, key)
+		},
+		"lookupHash": func(key string) (map[string]interface{}, error) {
+			return lookupHash(layers, key)
+		},
+	})
+
 	var buf bytes.Buffer
 
 	err = tmpl.Execute(&buf, host)
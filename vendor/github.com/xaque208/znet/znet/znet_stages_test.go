@@ -0,0 +1,135 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeDriver is a NetworkDeviceDriver that records which methods were
+// called, so tests can assert on locking/unlocking sequencing without a
+// real network device.
+type fakeDriver struct {
+	lockErr     error
+	loadErr     error
+	diffErr     error
+	commitErr   error
+	rollbackErr error
+
+	locked   bool
+	unlocked bool
+	closed   bool
+}
+
+func (d *fakeDriver) Connect(ctx context.Context, host *NetworkHost, creds Credentials) error {
+	return nil
+}
+
+func (d *fakeDriver) Lock(ctx context.Context) error {
+	if d.lockErr != nil {
+		return d.lockErr
+	}
+	d.locked = true
+	return nil
+}
+
+func (d *fakeDriver) LoadCandidate(ctx context.Context, rendered []string) error {
+	return d.loadErr
+}
+
+func (d *fakeDriver) Diff(ctx context.Context) (string, error) {
+	return "", d.diffErr
+}
+
+func (d *fakeDriver) Commit(ctx context.Context) error {
+	return d.commitErr
+}
+
+func (d *fakeDriver) Rollback(ctx context.Context) error {
+	return d.rollbackErr
+}
+
+func (d *fakeDriver) Unlock(ctx context.Context) error {
+	d.unlocked = true
+	return nil
+}
+
+func (d *fakeDriver) Close() error {
+	d.closed = true
+	return nil
+}
+
+// newStageTestHost returns a host with an empty data hierarchy, so
+// RenderCandidateConfig produces no templates and planWithDriver never
+// touches the filesystem.
+func newStageTestHost() *NetworkHost {
+	return &NetworkHost{HostName: "switch1.example.com", Name: "switch1"}
+}
+
+func TestPlanWithDriverReportsLockedOnDiffError(t *testing.T) {
+	z := &Znet{}
+	driver := &fakeDriver{diffErr: errors.New("diff failed")}
+
+	_, locked, err := z.planWithDriver(context.Background(), driver, newStageTestHost())
+	if err == nil {
+		t.Fatal("expected an error from a failing Diff")
+	}
+	if !locked {
+		t.Fatal("expected locked to be true once Lock succeeded, even though Diff failed")
+	}
+}
+
+func TestPlanWithDriverDoesNotReportLockedOnLockFailure(t *testing.T) {
+	z := &Znet{}
+	driver := &fakeDriver{lockErr: errors.New("lock failed")}
+
+	_, locked, err := z.planWithDriver(context.Background(), driver, newStageTestHost())
+	if err == nil {
+		t.Fatal("expected an error from a failing Lock")
+	}
+	if locked {
+		t.Fatal("expected locked to be false since Lock itself failed")
+	}
+}
+
+func TestConfigureNetworkHostUnlocksOnNoChanges(t *testing.T) {
+	z := &Znet{Credentials: stubCredentialProvider{}}
+	driver := &fakeDriver{}
+	RegisterDriver("stage-test-noop", func() NetworkDeviceDriver { return driver })
+
+	host := newStageTestHost()
+	host.Driver = "stage-test-noop"
+
+	if _, err := z.ConfigureNetworkHost(context.Background(), host, true); err != nil {
+		t.Fatalf("ConfigureNetworkHost: %v", err)
+	}
+
+	if !driver.locked || !driver.unlocked {
+		t.Fatalf("expected Lock and Unlock to both run, got locked=%v unlocked=%v", driver.locked, driver.unlocked)
+	}
+}
+
+func TestConfigureNetworkHostUnlocksOnDiffError(t *testing.T) {
+	z := &Znet{Credentials: stubCredentialProvider{}}
+	driver := &fakeDriver{diffErr: errors.New("diff failed")}
+	RegisterDriver("stage-test-commit-err", func() NetworkDeviceDriver { return driver })
+
+	host := newStageTestHost()
+	host.Driver = "stage-test-commit-err"
+
+	if _, err := z.ConfigureNetworkHost(context.Background(), host, true); err == nil {
+		t.Fatal("expected an error from a failing Diff")
+	}
+
+	if !driver.unlocked {
+		t.Fatal("expected Unlock to run even though Diff failed")
+	}
+}
+
+// stubCredentialProvider returns empty Credentials without touching viper,
+// so these stage tests don't depend on global configuration state.
+type stubCredentialProvider struct{}
+
+func (stubCredentialProvider) CredentialsFor(ctx context.Context, host *NetworkHost) (Credentials, error) {
+	return Credentials{}, nil
+}